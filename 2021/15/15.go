@@ -1,10 +1,9 @@
 package main
 
 import (
-	"math"
-
 	"github.com/liennie/AdventOfCode/common/load"
 	"github.com/liennie/AdventOfCode/common/log"
+	"github.com/liennie/AdventOfCode/common/path"
 	"github.com/liennie/AdventOfCode/common/util"
 )
 
@@ -18,42 +17,46 @@ func parse(filename string) [][]int {
 	return res
 }
 
-func smallestRisk(risk [][]int) int {
-	totalRisk := make([][]int, len(risk))
-	for i := range risk {
-		totalRisk[i] = make([]int, len(risk[i]))
-		for j := range totalRisk[i] {
-			totalRisk[i][j] = math.MaxInt
+func expand(risk [][]int, times int) [][]int {
+	height := len(risk)
+	width := len(risk[0])
+
+	res := make([][]int, height*times)
+	for y := range res {
+		res[y] = make([]int, width*times)
+		for x := range res[y] {
+			v := risk[y%height][x%width] + y/height + x/width
+			res[y][x] = (v-1)%9 + 1
 		}
 	}
-	totalRisk[0][0] = 0
 
-	points := map[util.Point]bool{
-		{X: 0, Y: 0}: true,
-	}
-	for len(points) > 0 {
-		var p util.Point
-		for p = range points {
-			break
-		}
-		delete(points, p)
+	return res
+}
 
-		cur := totalRisk[p.Y][p.X]
+func neighbors(risk [][]int) func(util.Point) []path.Step {
+	return func(p util.Point) []path.Step {
+		steps := make([]path.Step, 0, 4)
 
 		for _, dir := range []util.Point{{Y: -1}, {Y: 1}, {X: -1}, {X: 1}} {
 			n := p.Add(dir)
-			if n.Y >= 0 && n.X >= 0 && n.Y < len(risk) && n.X < len(risk[n.Y]) &&
-				cur+risk[n.Y][n.X] < totalRisk[n.Y][n.X] {
-				points[n] = true
-				totalRisk[n.Y][n.X] = cur + risk[n.Y][n.X]
+			if n.Y >= 0 && n.X >= 0 && n.Y < len(risk) && n.X < len(risk[n.Y]) {
+				steps = append(steps, path.Step{
+					To:   n,
+					Cost: risk[n.Y][n.X],
+				})
 			}
 		}
+
+		return steps
 	}
+}
 
+func smallestRisk(risk [][]int) int {
+	start := util.Point{X: 0, Y: 0}
 	end := util.Point{Y: len(risk) - 1}
 	end.X = len(risk[end.Y]) - 1
 
-	return totalRisk[end.Y][end.X]
+	return path.Dijkstra(start, end, neighbors(risk))
 }
 
 func main() {
@@ -65,4 +68,7 @@ func main() {
 
 	// Part 1
 	log.Part1(smallestRisk(risk))
+
+	// Part 2
+	log.Part2(smallestRisk(expand(risk, 5)))
 }
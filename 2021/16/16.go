@@ -1,8 +1,9 @@
 package main
 
 import (
+	"encoding/hex"
+	"fmt"
 	"math"
-	"strconv"
 	"strings"
 
 	"github.com/liennie/AdventOfCode/common/load"
@@ -10,18 +11,50 @@ import (
 	"github.com/liennie/AdventOfCode/common/util"
 )
 
+// bitReader is a cursor over raw bytes that reads up to 64 bits at a time,
+// shifting across byte boundaries as needed.
 type bitReader struct {
-	bits string
-	pos  int
+	data      []byte
+	bytePos   int
+	bitOffset uint
 }
 
 func (r *bitReader) next(n int) int {
-	res, err := strconv.ParseInt(r.bits[r.pos:r.pos+n], 2, 0)
-	if err != nil {
-		util.Panic("Invalid bits %q: %w", r.bits[r.pos:r.pos+n], err)
+	return int(r.nextU64(uint(n)))
+}
+
+func (r *bitReader) nextU64(n uint) uint64 {
+	var res uint64
+
+	for n > 0 {
+		if r.bytePos >= len(r.data) {
+			util.Panic("Read past end of data")
+		}
+
+		avail := 8 - r.bitOffset
+		take := avail
+		if take > n {
+			take = n
+		}
+
+		shift := avail - take
+		bits := (uint64(r.data[r.bytePos]) >> shift) & (1<<take - 1)
+		res = res<<take | bits
+
+		r.bitOffset += take
+		if r.bitOffset == 8 {
+			r.bitOffset = 0
+			r.bytePos++
+		}
+		n -= take
 	}
-	r.pos += n
-	return int(res)
+
+	return res
+}
+
+// bitPos returns the number of bits read so far.
+func (r *bitReader) bitPos() int {
+	return r.bytePos*8 + int(r.bitOffset)
 }
 
 var hex2binLut = map[rune]string{
@@ -49,208 +82,257 @@ func loadFile(filename string) *bitReader {
 
 	msg := <-ch
 
-	r := &bitReader{}
-	b := &strings.Builder{}
-
-	for _, r := range msg {
-		b.WriteString(hex2binLut[r])
+	data, err := hex.DecodeString(msg)
+	if err != nil {
+		util.Panic("Invalid hex %q: %w", msg, err)
 	}
 
-	r.bits = b.String()
-
-	return r
+	return &bitReader{data: data}
 }
 
-type packet interface {
+// Packet is a single decoded BITS packet, either a LiteralPacket or an
+// OperatorPacket.
+type Packet interface {
 	versionSum() int
 	value() int
 }
 
-type sumPacket struct {
-	operatorPacket
-}
+// PacketOp identifies the operator of an OperatorPacket.
+type PacketOp int
 
-func (p sumPacket) value() int {
-	if len(p.subs) == 0 {
-		util.Panic("No subpackets")
-	}
-
-	sum := 0
-	for _, sp := range p.subs {
-		sum += sp.value()
-	}
-	return sum
-}
+const (
+	OpSum     PacketOp = 0
+	OpProduct PacketOp = 1
+	OpMin     PacketOp = 2
+	OpMax     PacketOp = 3
+	OpLiteral PacketOp = 4
+	OpGT      PacketOp = 5
+	OpLT      PacketOp = 6
+	OpEQ      PacketOp = 7
+)
 
-type productPacket struct {
-	operatorPacket
+type opInfo struct {
+	name string
+	eval func([]int) int
 }
 
-func (p productPacket) value() int {
-	if len(p.subs) == 0 {
-		util.Panic("No subpackets")
-	}
-
-	sum := 1
-	for _, sp := range p.subs {
-		sum *= sp.value()
-	}
-	return sum
-}
+var opTable = map[PacketOp]opInfo{
+	OpSum: {
+		name: "sum",
+		eval: func(vals []int) int {
+			if len(vals) == 0 {
+				util.Panic("No subpackets")
+			}
 
-type minPacket struct {
-	operatorPacket
-}
+			sum := 0
+			for _, v := range vals {
+				sum += v
+			}
+			return sum
+		},
+	},
+	OpProduct: {
+		name: "product",
+		eval: func(vals []int) int {
+			if len(vals) == 0 {
+				util.Panic("No subpackets")
+			}
 
-func (p minPacket) value() int {
-	if len(p.subs) == 0 {
-		util.Panic("No subpackets")
-	}
+			prod := 1
+			for _, v := range vals {
+				prod *= v
+			}
+			return prod
+		},
+	},
+	OpMin: {
+		name: "min",
+		eval: func(vals []int) int {
+			if len(vals) == 0 {
+				util.Panic("No subpackets")
+			}
 
-	min := math.MaxInt
-	for _, sp := range p.subs {
-		if v := sp.value(); v < min {
-			min = v
-		}
-	}
-	return min
-}
+			min := math.MaxInt
+			for _, v := range vals {
+				if v < min {
+					min = v
+				}
+			}
+			return min
+		},
+	},
+	OpMax: {
+		name: "max",
+		eval: func(vals []int) int {
+			if len(vals) == 0 {
+				util.Panic("No subpackets")
+			}
 
-type maxPacket struct {
-	operatorPacket
+			max := math.MinInt
+			for _, v := range vals {
+				if v > max {
+					max = v
+				}
+			}
+			return max
+		},
+	},
+	OpGT: {
+		name: "gt",
+		eval: func(vals []int) int {
+			if len(vals) != 2 {
+				util.Panic("Invalid number of subpackets")
+			}
+			if vals[0] > vals[1] {
+				return 1
+			}
+			return 0
+		},
+	},
+	OpLT: {
+		name: "lt",
+		eval: func(vals []int) int {
+			if len(vals) != 2 {
+				util.Panic("Invalid number of subpackets")
+			}
+			if vals[0] < vals[1] {
+				return 1
+			}
+			return 0
+		},
+	},
+	OpEQ: {
+		name: "eq",
+		eval: func(vals []int) int {
+			if len(vals) != 2 {
+				util.Panic("Invalid number of subpackets")
+			}
+			if vals[0] == vals[1] {
+				return 1
+			}
+			return 0
+		},
+	},
 }
 
-func (p maxPacket) value() int {
-	if len(p.subs) == 0 {
-		util.Panic("No subpackets")
+func (op PacketOp) String() string {
+	info, ok := opTable[op]
+	if !ok {
+		util.Panic("Invalid op %d", int(op))
 	}
+	return info.name
+}
 
-	max := math.MinInt
-	for _, sp := range p.subs {
-		if v := sp.value(); v > max {
-			max = v
-		}
+// Eval applies op to the values of its subpackets.
+func (op PacketOp) Eval(vals []int) int {
+	info, ok := opTable[op]
+	if !ok {
+		util.Panic("Invalid op %d", int(op))
 	}
-	return max
+	return info.eval(vals)
 }
 
-type literalValuePacket struct {
+// LiteralPacket is a BITS packet carrying a single literal value.
+type LiteralPacket struct {
 	ver int
 	val int
 }
 
-func (p literalValuePacket) versionSum() int {
+func (p LiteralPacket) versionSum() int {
 	return p.ver
 }
 
-func (p literalValuePacket) value() int {
+func (p LiteralPacket) value() int {
 	return p.val
 }
 
-type gtPacket struct {
-	operatorPacket
+// OperatorPacket is a BITS packet applying op to the values of subs.
+type OperatorPacket struct {
+	ver  int
+	op   PacketOp
+	subs []Packet
 }
 
-func (p gtPacket) value() int {
-	if len(p.subs) != 2 {
-		util.Panic("Invalid number of subpackets")
-	}
-
-	if p.subs[0].value() > p.subs[1].value() {
-		return 1
+func (p OperatorPacket) versionSum() int {
+	sum := p.ver
+	for _, sp := range p.subs {
+		sum += sp.versionSum()
 	}
-	return 0
+	return sum
 }
 
-type ltPacket struct {
-	operatorPacket
+func (p OperatorPacket) value() int {
+	vals := make([]int, len(p.subs))
+	for i, sp := range p.subs {
+		vals[i] = sp.value()
+	}
+	return p.op.Eval(vals)
 }
 
-func (p ltPacket) value() int {
-	if len(p.subs) != 2 {
-		util.Panic("Invalid number of subpackets")
+// Optimize folds any subtree of p whose leaves are all literals into a
+// single LiteralPacket, summing versions into the folded node. Since every
+// Packet leaf is a LiteralPacket, this always folds a whole well-formed tree
+// down to one LiteralPacket, which also covers the "exactly one sub-packet"
+// sum/product/min/max identities the BITS grammar allows.
+func Optimize(p Packet) Packet {
+	op, ok := p.(OperatorPacket)
+	if !ok {
+		return p
 	}
 
-	if p.subs[0].value() < p.subs[1].value() {
-		return 1
-	}
-	return 0
-}
+	subs := make([]Packet, len(op.subs))
+	ver := op.ver
+	vals := make([]int, len(op.subs))
+	for i, sp := range op.subs {
+		subs[i] = Optimize(sp)
 
-type eqPacket struct {
-	operatorPacket
-}
-
-func (p eqPacket) value() int {
-	if len(p.subs) != 2 {
-		util.Panic("Invalid number of subpackets")
+		lit := subs[i].(LiteralPacket)
+		ver += lit.ver
+		vals[i] = lit.val
 	}
 
-	if p.subs[0].value() == p.subs[1].value() {
-		return 1
+	return LiteralPacket{
+		ver: ver,
+		val: op.op.Eval(vals),
 	}
-	return 0
 }
 
-type genericOperatorPacket struct {
-	operatorPacket
-	id int
-}
+// Walk calls visit for p and recursively for every subpacket of p, in
+// depth-first order.
+func Walk(p Packet, visit func(Packet)) {
+	visit(p)
 
-func (p genericOperatorPacket) impl() packet {
-	switch p.id {
-	case typeSum:
-		return sumPacket{operatorPacket: p.operatorPacket}
-	case typeProduct:
-		return productPacket{operatorPacket: p.operatorPacket}
-	case typeMin:
-		return minPacket{operatorPacket: p.operatorPacket}
-	case typeMax:
-		return maxPacket{operatorPacket: p.operatorPacket}
-	case typeGT:
-		return gtPacket{operatorPacket: p.operatorPacket}
-	case typeLT:
-		return ltPacket{operatorPacket: p.operatorPacket}
-	case typeEQ:
-		return eqPacket{operatorPacket: p.operatorPacket}
+	if op, ok := p.(OperatorPacket); ok {
+		for _, sp := range op.subs {
+			Walk(sp, visit)
+		}
 	}
-
-	util.Panic("Invalid operator id %d", p.id)
-	return nil
 }
 
-type operatorPacket struct {
-	ver  int
-	subs []packet
-}
+// Format renders p as an S-expression, e.g. "(sum (lit 1) (gt (lit 3) (lit 2)))".
+func Format(p Packet) string {
+	switch tp := p.(type) {
+	case LiteralPacket:
+		return fmt.Sprintf("(lit %d)", tp.val)
 
-func (p operatorPacket) versionSum() int {
-	sum := p.ver
-	for _, sp := range p.subs {
-		sum += sp.versionSum()
+	case OperatorPacket:
+		subs := make([]string, len(tp.subs))
+		for i, sp := range tp.subs {
+			subs[i] = Format(sp)
+		}
+		return fmt.Sprintf("(%s %s)", tp.op, strings.Join(subs, " "))
+
+	default:
+		util.Panic("Unknown packet type %T", p)
+		return ""
 	}
-	return sum
 }
 
-const (
-	typeSum     = 0
-	typeProduct = 1
-	typeMin     = 2
-	typeMax     = 3
-	typeLiteral = 4
-	typeGT      = 5
-	typeLT      = 6
-	typeEQ      = 7
-)
-
-func parsePacket(r *bitReader) packet {
+func parsePacket(r *bitReader) Packet {
 	ver := r.next(3)
-	_ = ver
-
 	id := r.next(3)
 
-	switch id {
-	case typeLiteral:
+	if PacketOp(id) == OpLiteral {
 		lit := 0
 		for {
 			n := r.next(5)
@@ -259,41 +341,145 @@ func parsePacket(r *bitReader) packet {
 			lit |= n & 0xf
 
 			if n&0x10 == 0 {
-				return literalValuePacket{
+				return LiteralPacket{
 					ver: ver,
 					val: lit,
 				}
 			}
 		}
+	}
 
-	default:
-		op := genericOperatorPacket{
-			operatorPacket: operatorPacket{
-				ver: ver,
-			},
-			id: id,
+	op := OperatorPacket{
+		ver: ver,
+		op:  PacketOp(id),
+	}
+
+	lenId := r.next(1)
+	if lenId == 0 {
+		len := r.next(15)
+		to := r.bitPos() + len
+		for r.bitPos() < to {
+			op.subs = append(op.subs, parsePacket(r))
+		}
+		if r.bitPos() > to {
+			util.Panic("Len overflow %d > %d", r.bitPos(), to)
 		}
 
-		lenId := r.next(1)
-		if lenId == 0 {
-			len := r.next(15)
-			to := r.pos + len
-			for r.pos < to {
-				op.subs = append(op.subs, parsePacket(r))
-			}
-			if r.pos > to {
-				util.Panic("Len overflow %d > %d", r.pos, to)
-			}
+	} else {
+		subs := r.next(11)
+		for i := 0; i < subs; i++ {
+			op.subs = append(op.subs, parsePacket(r))
+		}
+	}
+
+	return op
+}
 
+type bitWriter struct {
+	bits strings.Builder
+}
+
+func (w *bitWriter) write(n, v int) {
+	for i := n - 1; i >= 0; i-- {
+		if v&(1<<i) != 0 {
+			w.bits.WriteByte('1')
 		} else {
-			subs := r.next(11)
-			for i := 0; i < subs; i++ {
-				op.subs = append(op.subs, parsePacket(r))
-			}
+			w.bits.WriteByte('0')
 		}
+	}
+}
+
+var bin2hexLut = func() map[string]rune {
+	lut := make(map[string]rune, len(hex2binLut))
+	for r, b := range hex2binLut {
+		lut[b] = r
+	}
+	return lut
+}()
+
+func (w *bitWriter) hex() string {
+	bits := w.bits.String()
+	for len(bits)%8 != 0 {
+		bits += "0"
+	}
+
+	res := &strings.Builder{}
+	for i := 0; i < len(bits); i += 4 {
+		res.WriteRune(bin2hexLut[bits[i:i+4]])
+	}
+
+	return res.String()
+}
+
+// encodePacket encodes p as a BITS hex string. Operator packets default to
+// the total-length-in-bits form (lenId 0); pass forceSubCount=true to use
+// the number-of-subpackets form (lenId 1) instead.
+func encodePacket(p Packet, forceSubCount ...bool) string {
+	w := &bitWriter{}
+	writePacket(w, p, len(forceSubCount) > 0 && forceSubCount[0])
+	return w.hex()
+}
+
+func writePacket(w *bitWriter, p Packet, forceSubCount bool) {
+	switch tp := p.(type) {
+	case LiteralPacket:
+		writeLiteral(w, tp)
+	case OperatorPacket:
+		writeOperator(w, tp, forceSubCount)
+	default:
+		util.Panic("Unknown packet type %T", p)
+	}
+}
+
+func writeLiteral(w *bitWriter, p LiteralPacket) {
+	w.write(3, p.ver)
+	w.write(3, int(OpLiteral))
 
-		return op.impl()
+	groups := literalGroups(p.val)
+	for i, g := range groups {
+		more := 0
+		if i < len(groups)-1 {
+			more = 0x10
+		}
+		w.write(5, more|g)
+	}
+}
+
+func literalGroups(val int) []int {
+	if val == 0 {
+		return []int{0}
+	}
+
+	groups := []int{}
+	for val > 0 {
+		groups = append([]int{val & 0xf}, groups...)
+		val >>= 4
+	}
+	return groups
+}
+
+func writeOperator(w *bitWriter, p OperatorPacket, forceSubCount bool) {
+	w.write(3, p.ver)
+	w.write(3, int(p.op))
+
+	if forceSubCount {
+		w.write(1, 1)
+		w.write(11, len(p.subs))
+		for _, sp := range p.subs {
+			writePacket(w, sp, forceSubCount)
+		}
+		return
+	}
+
+	w.write(1, 0)
+
+	body := &bitWriter{}
+	for _, sp := range p.subs {
+		writePacket(body, sp, forceSubCount)
 	}
+
+	w.write(15, body.bits.Len())
+	w.bits.WriteString(body.bits.String())
 }
 
 func main() {
@@ -308,5 +494,5 @@ func main() {
 	log.Part1(packet.versionSum())
 
 	// Part 2
-	log.Part2(packet.value())
+	log.Part2(Optimize(packet).value())
 }
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// equalPacket reports whether a and b are structurally equal, including
+// version numbers, not just whether they evaluate to the same value.
+func equalPacket(a, b Packet) bool {
+	switch ta := a.(type) {
+	case LiteralPacket:
+		tb, ok := b.(LiteralPacket)
+		return ok && ta == tb
+
+	case OperatorPacket:
+		tb, ok := b.(OperatorPacket)
+		if !ok || ta.ver != tb.ver || ta.op != tb.op || len(ta.subs) != len(tb.subs) {
+			return false
+		}
+
+		for i := range ta.subs {
+			if !equalPacket(ta.subs[i], tb.subs[i]) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+func TestEncodePacketRoundTrip(t *testing.T) {
+	tests := []string{
+		"8A004A801A8002F478",
+		"620080001611562C8802118E34",
+		"C0015000016115A2E0802F182340",
+		"A0016C880162017C3686B18A3D4780",
+		"C200B40A82",
+		"04005AC33890",
+		"880086C3E88112",
+		"CE00C43D881120",
+		"D8005AC2A8F0",
+		"F600BC2D8F",
+		"9C005AC2F8F0",
+		"9C0141080250320F1802104A08",
+	}
+
+	for _, tt := range tests {
+		p := parseHex(t, tt)
+
+		for _, forceSubCount := range []bool{false, true} {
+			got := parseHex(t, encodePacket(p, forceSubCount))
+
+			if !equalPacket(got, p) {
+				t.Errorf("%s: round trip (forceSubCount=%v) gave %s, want %s", tt, forceSubCount, Format(got), Format(p))
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func parseHex(t *testing.T, s string) Packet {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("DecodeString(%q): %v", s, err)
+	}
+
+	return parsePacket(&bitReader{data: data})
+}
+
+func TestOptimizeValue(t *testing.T) {
+	tests := []struct {
+		hex string
+		val int
+	}{
+		{"C200B40A82", 3},
+		{"04005AC33890", 54},
+		{"880086C3E88112", 7},
+		{"CE00C43D881120", 9},
+		{"D8005AC2A8F0", 1},
+		{"F600BC2D8F", 0},
+		{"9C005AC2F8F0", 0},
+		{"9C0141080250320F1802104A08", 1},
+	}
+
+	for _, tt := range tests {
+		p := parseHex(t, tt.hex)
+
+		if got := Optimize(p).value(); got != tt.val {
+			t.Errorf("Optimize(%s).value() = %d, want %d", tt.hex, got, tt.val)
+		}
+	}
+}
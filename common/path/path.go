@@ -0,0 +1,118 @@
+// Package path implements generic grid pathfinding on top of util.Point.
+package path
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/liennie/AdventOfCode/common/util"
+)
+
+// Step is a single edge from the point it was generated for to a
+// neighboring point, with the cost of taking that edge.
+type Step struct {
+	To   util.Point
+	Cost int
+}
+
+// Heuristic estimates the remaining cost from a point to the goal. AStar
+// never revisits a point once it has been expanded, so it finds the optimal
+// path only if the heuristic is consistent: the estimate at a point never
+// exceeds the cost of a step plus the estimate at that step's target.
+type Heuristic func(util.Point) int
+
+// ManhattanDistance returns a Heuristic measuring the Manhattan distance to
+// goal, suitable for grids where steps only move along X or Y.
+func ManhattanDistance(goal util.Point) Heuristic {
+	return func(p util.Point) int {
+		dx := goal.X - p.X
+		if dx < 0 {
+			dx = -dx
+		}
+		dy := goal.Y - p.Y
+		if dy < 0 {
+			dy = -dy
+		}
+		return dx + dy
+	}
+}
+
+// Dijkstra returns the cost of the cheapest path from start to end, calling
+// neighbors to expand each point as it is visited. It returns math.MaxInt if
+// end is unreachable.
+func Dijkstra(start, end util.Point, neighbors func(util.Point) []Step) int {
+	return search(start, end, neighbors, nil)
+}
+
+// AStar is like Dijkstra, but uses heuristic to guide the search towards end.
+func AStar(start, end util.Point, neighbors func(util.Point) []Step, heuristic Heuristic) int {
+	return search(start, end, neighbors, heuristic)
+}
+
+func search(start, end util.Point, neighbors func(util.Point) []Step, heuristic Heuristic) int {
+	// dist and visited are maps rather than math.MaxInt-initialized slices:
+	// this package is generic over any util.Point graph, not just bounded
+	// grids, so there's no width/height here to size a slice against. A
+	// missing map entry plays the same role as a slice cell pre-filled with
+	// math.MaxInt.
+	dist := map[util.Point]int{
+		start: 0,
+	}
+	visited := map[util.Point]bool{}
+
+	open := &openSet{{point: start}}
+	heap.Init(open)
+
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(item).point
+		if visited[cur] {
+			continue
+		}
+		visited[cur] = true
+
+		if cur == end {
+			return dist[cur]
+		}
+
+		curDist := dist[cur]
+
+		for _, step := range neighbors(cur) {
+			next := curDist + step.Cost
+
+			if nDist, ok := dist[step.To]; !ok || next < nDist {
+				dist[step.To] = next
+
+				priority := next
+				if heuristic != nil {
+					priority += heuristic(step.To)
+				}
+
+				heap.Push(open, item{point: step.To, priority: priority})
+			}
+		}
+	}
+
+	return math.MaxInt
+}
+
+type item struct {
+	point    util.Point
+	priority int
+}
+
+type openSet []item
+
+func (s openSet) Len() int { return len(s) }
+
+func (s openSet) Less(i, j int) bool { return s[i].priority < s[j].priority }
+
+func (s openSet) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s *openSet) Push(x interface{}) { *s = append(*s, x.(item)) }
+func (s *openSet) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[:n-1]
+	return x
+}
@@ -0,0 +1,42 @@
+package path
+
+import (
+	"testing"
+
+	"github.com/liennie/AdventOfCode/common/util"
+)
+
+// gridNeighbors returns a neighbors callback for a width x height grid of
+// uniform cost-1 steps, with no diagonal movement.
+func gridNeighbors(width, height int) func(util.Point) []Step {
+	return func(p util.Point) []Step {
+		steps := make([]Step, 0, 4)
+
+		for _, dir := range []util.Point{{Y: -1}, {Y: 1}, {X: -1}, {X: 1}} {
+			n := p.Add(dir)
+			if n.X >= 0 && n.Y >= 0 && n.X < width && n.Y < height {
+				steps = append(steps, Step{To: n, Cost: 1})
+			}
+		}
+
+		return steps
+	}
+}
+
+func TestDijkstra(t *testing.T) {
+	start := util.Point{X: 0, Y: 0}
+	end := util.Point{X: 2, Y: 2}
+
+	if got := Dijkstra(start, end, gridNeighbors(3, 3)); got != 4 {
+		t.Errorf("Dijkstra() = %d, want 4", got)
+	}
+}
+
+func TestAStar(t *testing.T) {
+	start := util.Point{X: 0, Y: 0}
+	end := util.Point{X: 2, Y: 2}
+
+	if got := AStar(start, end, gridNeighbors(3, 3), ManhattanDistance(end)); got != 4 {
+		t.Errorf("AStar() = %d, want 4", got)
+	}
+}